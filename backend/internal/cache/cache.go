@@ -0,0 +1,199 @@
+// Package cache implements a bounded on-disk LRU cache for images fetched
+// from PocketBase, so hot collections can be served without a round trip
+// on every request.
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Entry holds the metadata stored alongside a cached image's bytes.
+type Entry struct {
+	Collection  string
+	RecordID    string
+	Filename    string
+	ContentType string
+	ETag        string
+	FetchedAt   time.Time
+	Size        int64
+}
+
+type entryNode struct {
+	Entry
+	path string
+}
+
+// Cache is a bounded on-disk LRU cache keyed by (collection, record ID).
+// Image bytes live on disk under Dir; a small in-memory index tracks LRU
+// order and per-collection membership so entries can be evicted once
+// MaxBytes or MaxEntries is exceeded.
+type Cache struct {
+	dir        string
+	maxBytes   int64
+	maxEntries int
+
+	mu           sync.Mutex
+	order        *list.List // front = most recently used
+	nodes        map[string]*list.Element
+	byCollection map[string]map[string]struct{}
+	totalBytes   int64
+
+	hits   int64
+	misses int64
+}
+
+// New creates a Cache rooted at dir, creating the directory if needed.
+// maxBytes or maxEntries of 0 means that budget is unbounded.
+func New(dir string, maxBytes int64, maxEntries int) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	return &Cache{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		maxEntries:   maxEntries,
+		order:        list.New(),
+		nodes:        make(map[string]*list.Element),
+		byCollection: make(map[string]map[string]struct{}),
+	}, nil
+}
+
+func cacheKey(collection, recordID string) string {
+	return collection + "/" + recordID
+}
+
+func (c *Cache) pathFor(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// Put stores an image's bytes and metadata, evicting least-recently-used
+// entries afterwards if the size or entry budget is exceeded.
+func (c *Cache) Put(entry Entry, data []byte) error {
+	key := cacheKey(entry.Collection, entry.RecordID)
+	path := c.pathFor(key)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	entry.Size = int64(len(data))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.nodes[key]; ok {
+		c.unindexLocked(elem)
+	}
+	if c.byCollection[entry.Collection] == nil {
+		c.byCollection[entry.Collection] = make(map[string]struct{})
+	}
+	c.byCollection[entry.Collection][key] = struct{}{}
+
+	node := &entryNode{Entry: entry, path: path}
+	elem := c.order.PushFront(node)
+	c.nodes[key] = elem
+	c.totalBytes += entry.Size
+
+	c.evictLocked()
+	return nil
+}
+
+// TakeWarm removes and returns one cached entry for collection, if any.
+// Entries are consumed on read, matching the "a different random image
+// per request" behavior of the uncached path; the prefetcher is
+// responsible for topping the collection back up afterwards.
+func (c *Cache) TakeWarm(collection string) ([]byte, Entry, bool) {
+	c.mu.Lock()
+	var key string
+	for k := range c.byCollection[collection] {
+		key = k
+		break
+	}
+	if key == "" {
+		c.mu.Unlock()
+		atomic.AddInt64(&c.misses, 1)
+		return nil, Entry{}, false
+	}
+	node := c.unindexLocked(c.nodes[key])
+	c.mu.Unlock()
+
+	data, err := os.ReadFile(node.path)
+	os.Remove(node.path)
+	if err != nil {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, Entry{}, false
+	}
+
+	atomic.AddInt64(&c.hits, 1)
+	return data, node.Entry, true
+}
+
+// WarmCount reports how many entries are currently cached for collection.
+func (c *Cache) WarmCount(collection string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.byCollection[collection])
+}
+
+// Purge drops every cached entry for collection and returns how many
+// entries were removed.
+func (c *Cache) Purge(collection string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for key := range c.byCollection[collection] {
+		c.removeLocked(c.nodes[key])
+		removed++
+	}
+	return removed
+}
+
+// Hits and Misses report cumulative TakeWarm outcomes.
+func (c *Cache) Hits() int64   { return atomic.LoadInt64(&c.hits) }
+func (c *Cache) Misses() int64 { return atomic.LoadInt64(&c.misses) }
+
+// unindexLocked drops elem from the LRU order and index without touching
+// its on-disk file. Caller must hold mu.
+func (c *Cache) unindexLocked(elem *list.Element) *entryNode {
+	node := elem.Value.(*entryNode)
+	key := cacheKey(node.Collection, node.RecordID)
+
+	c.order.Remove(elem)
+	delete(c.nodes, key)
+	if set := c.byCollection[node.Collection]; set != nil {
+		delete(set, key)
+		if len(set) == 0 {
+			delete(c.byCollection, node.Collection)
+		}
+	}
+	c.totalBytes -= node.Size
+
+	return node
+}
+
+// removeLocked evicts elem, deleting its on-disk file. Caller must hold mu.
+func (c *Cache) removeLocked(elem *list.Element) {
+	node := c.unindexLocked(elem)
+	os.Remove(node.path)
+}
+
+// evictLocked drops least-recently-used entries until the cache is back
+// within its configured budget. Caller must hold mu.
+func (c *Cache) evictLocked() {
+	for (c.maxBytes > 0 && c.totalBytes > c.maxBytes) || (c.maxEntries > 0 && len(c.nodes) > c.maxEntries) {
+		oldest := c.order.Back()
+		if oldest == nil {
+			return
+		}
+		c.removeLocked(oldest)
+	}
+}
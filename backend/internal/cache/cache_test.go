@@ -0,0 +1,91 @@
+package cache
+
+import "testing"
+
+func TestCacheTakeWarmConsumesEntry(t *testing.T) {
+	c, err := New(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	entry := Entry{Collection: "cats", RecordID: "abc", ContentType: "image/jpeg"}
+	if err := c.Put(entry, []byte("hello")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	data, got, ok := c.TakeWarm("cats")
+	if !ok {
+		t.Fatalf("expected a warm entry")
+	}
+	if string(data) != "hello" || got.RecordID != "abc" {
+		t.Fatalf("unexpected entry: %+v %q", got, data)
+	}
+
+	if _, _, ok := c.TakeWarm("cats"); ok {
+		t.Fatalf("TakeWarm should consume the entry, but it was still present")
+	}
+	if c.Hits() != 1 || c.Misses() != 1 {
+		t.Fatalf("Hits()=%d Misses()=%d, want 1 and 1", c.Hits(), c.Misses())
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsedOverEntryBudget(t *testing.T) {
+	c, err := New(t.TempDir(), 0, 2)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	put := func(id string) {
+		if err := c.Put(Entry{Collection: "cats", RecordID: id}, []byte(id)); err != nil {
+			t.Fatalf("Put(%s): %v", id, err)
+		}
+	}
+
+	put("a")
+	put("b")
+	put("c") // over budget; "a" is least recently used and should be evicted
+
+	if got := c.WarmCount("cats"); got != 2 {
+		t.Fatalf("WarmCount = %d, want 2", got)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		_, entry, ok := c.TakeWarm("cats")
+		if !ok {
+			t.Fatalf("expected a warm entry")
+		}
+		seen[entry.RecordID] = true
+	}
+	if seen["a"] {
+		t.Fatalf("expected %q to have been evicted, but it was still cached", "a")
+	}
+	if !seen["b"] || !seen["c"] {
+		t.Fatalf("expected b and c to still be cached, got %v", seen)
+	}
+}
+
+func TestCachePutOverwritesSoleEntryOfCollection(t *testing.T) {
+	c, err := New(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	entry := Entry{Collection: "cats", RecordID: "abc", ContentType: "image/jpeg"}
+	if err := c.Put(entry, []byte("first")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	// Re-putting the same (collection, record ID) while it's the only warm
+	// entry for that collection used to panic on a nil byCollection map.
+	if err := c.Put(entry, []byte("second")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	data, got, ok := c.TakeWarm("cats")
+	if !ok {
+		t.Fatalf("expected a warm entry")
+	}
+	if string(data) != "second" || got.RecordID != "abc" {
+		t.Fatalf("unexpected entry: %+v %q", got, data)
+	}
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// FetchFunc fetches one fresh image (bytes + metadata) for a collection,
+// typically a PocketBase random-record lookup.
+type FetchFunc func(ctx context.Context) ([]byte, Entry, error)
+
+// Prefetcher keeps a collection's warm set topped up to a target size by
+// fetching in the background, so request handlers can serve from cache
+// instead of round-tripping to PocketBase on every hit.
+type Prefetcher struct {
+	cache      *Cache
+	collection string
+	fetch      FetchFunc
+	warm       int
+	interval   time.Duration
+	stop       chan struct{}
+}
+
+// NewPrefetcher builds a Prefetcher for collection that tries to keep
+// warm entries cached, checking every interval.
+func NewPrefetcher(c *Cache, collection string, warm int, interval time.Duration, fetch FetchFunc) *Prefetcher {
+	return &Prefetcher{
+		cache:      c,
+		collection: collection,
+		fetch:      fetch,
+		warm:       warm,
+		interval:   interval,
+		stop:       make(chan struct{}),
+	}
+}
+
+// Run fills the collection's warm set and keeps topping it up on a timer
+// until ctx is canceled or Stop is called. Intended to be run in its own
+// goroutine.
+func (p *Prefetcher) Run(ctx context.Context) {
+	p.fill(ctx)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.fill(ctx)
+		}
+	}
+}
+
+// Stop ends the prefetch loop started by Run.
+func (p *Prefetcher) Stop() {
+	close(p.stop)
+}
+
+// fill tries to top the collection's warm set up to p.warm entries. It
+// caps itself at p.warm fetch attempts and bails out if a Put doesn't
+// actually raise WarmCount, so a misconfigured warm target that exceeds
+// what the global cache budget (max_bytes/max_entries) can hold degrades
+// instead of busy-looping fetches against PocketBase forever.
+func (p *Prefetcher) fill(ctx context.Context) {
+	for attempts := 0; attempts < p.warm && p.cache.WarmCount(p.collection) < p.warm; attempts++ {
+		before := p.cache.WarmCount(p.collection)
+
+		data, entry, err := p.fetch(ctx)
+		if err != nil {
+			log.Printf("cache: prefetch for %q failed: %v", p.collection, err)
+			return
+		}
+
+		entry.Collection = p.collection
+		entry.FetchedAt = time.Now()
+		if err := p.cache.Put(entry, data); err != nil {
+			log.Printf("cache: prefetch for %q failed to store: %v", p.collection, err)
+			return
+		}
+
+		if p.cache.WarmCount(p.collection) <= before {
+			log.Printf("cache: prefetch for %q stalled at %d/%d warm entries, likely exceeding the cache budget; stopping this round", p.collection, before, p.warm)
+			return
+		}
+	}
+}
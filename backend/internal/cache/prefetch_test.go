@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPrefetcherFillStopsWhenWarmTargetExceedsCacheBudget(t *testing.T) {
+	c, err := New(t.TempDir(), 0, 1) // budget for only 1 entry
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	var calls int32
+	fetch := func(ctx context.Context) ([]byte, Entry, error) {
+		n := atomic.AddInt32(&calls, 1)
+		return []byte("x"), Entry{RecordID: fmt.Sprintf("r%d", n)}, nil
+	}
+
+	// warm_per_source (10) can never be satisfied with a 1-entry budget;
+	// fill must give up instead of fetching forever.
+	p := NewPrefetcher(c, "cats", 10, time.Second, fetch)
+	p.fill(context.Background())
+
+	if got := atomic.LoadInt32(&calls); got > 10 {
+		t.Fatalf("fill made %d fetch calls chasing an unreachable warm target, want it to bail out early", got)
+	}
+}
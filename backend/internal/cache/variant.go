@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// VariantEntry holds the metadata stored alongside one cached, transformed
+// image variant (a specific size/format/quality of a source image).
+type VariantEntry struct {
+	ContentType string
+	Size        int64
+}
+
+type variantNode struct {
+	VariantEntry
+	key  string
+	path string
+}
+
+// VariantCache is a bounded on-disk LRU keyed by an opaque caller-supplied
+// string (typically source+recordID+dimensions+format+quality). Unlike
+// Cache, Get doesn't consume entries: the same variant is expected to be
+// requested repeatedly and should keep being served from cache.
+type VariantCache struct {
+	dir        string
+	maxBytes   int64
+	maxEntries int
+
+	mu         sync.Mutex
+	order      *list.List // front = most recently used
+	nodes      map[string]*list.Element
+	totalBytes int64
+}
+
+// NewVariantCache creates a VariantCache rooted at dir, creating the
+// directory if needed. maxBytes or maxEntries of 0 means that budget is
+// unbounded.
+func NewVariantCache(dir string, maxBytes int64, maxEntries int) (*VariantCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create variant cache directory: %w", err)
+	}
+
+	return &VariantCache{
+		dir:        dir,
+		maxBytes:   maxBytes,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		nodes:      make(map[string]*list.Element),
+	}, nil
+}
+
+func (vc *VariantCache) pathFor(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(vc.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get returns a cached variant for key, if present, moving it to the
+// front of the LRU order. A stale index entry whose file has since been
+// removed is treated as a miss and dropped from the index.
+func (vc *VariantCache) Get(key string) ([]byte, VariantEntry, bool) {
+	vc.mu.Lock()
+	elem, ok := vc.nodes[key]
+	if !ok {
+		vc.mu.Unlock()
+		return nil, VariantEntry{}, false
+	}
+	vc.order.MoveToFront(elem)
+	node := elem.Value.(*variantNode)
+	vc.mu.Unlock()
+
+	data, err := os.ReadFile(node.path)
+	if err != nil {
+		vc.mu.Lock()
+		vc.removeLocked(elem)
+		vc.mu.Unlock()
+		return nil, VariantEntry{}, false
+	}
+
+	return data, node.VariantEntry, true
+}
+
+// Put stores a transformed variant under key, evicting least-recently-used
+// entries afterwards if the size or entry budget is exceeded.
+func (vc *VariantCache) Put(key string, entry VariantEntry, data []byte) error {
+	path := vc.pathFor(key)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write variant cache file: %w", err)
+	}
+	entry.Size = int64(len(data))
+
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if elem, ok := vc.nodes[key]; ok {
+		// Same key hashes to the same path, so the file on disk was just
+		// overwritten above; drop the stale index entry without deleting it.
+		vc.unindexLocked(elem)
+	}
+
+	node := &variantNode{VariantEntry: entry, key: key, path: path}
+	elem := vc.order.PushFront(node)
+	vc.nodes[key] = elem
+	vc.totalBytes += entry.Size
+
+	vc.evictLocked()
+	return nil
+}
+
+// unindexLocked drops elem from the LRU order and index without touching
+// its on-disk file. Caller must hold mu.
+func (vc *VariantCache) unindexLocked(elem *list.Element) {
+	node := elem.Value.(*variantNode)
+	vc.order.Remove(elem)
+	delete(vc.nodes, node.key)
+	vc.totalBytes -= node.Size
+}
+
+// removeLocked evicts elem, deleting its on-disk file. Caller must hold mu.
+func (vc *VariantCache) removeLocked(elem *list.Element) {
+	node := elem.Value.(*variantNode)
+	vc.unindexLocked(elem)
+	os.Remove(node.path)
+}
+
+// evictLocked drops least-recently-used variants until the cache is back
+// within its configured budget. Caller must hold mu.
+func (vc *VariantCache) evictLocked() {
+	for (vc.maxBytes > 0 && vc.totalBytes > vc.maxBytes) || (vc.maxEntries > 0 && len(vc.nodes) > vc.maxEntries) {
+		oldest := vc.order.Back()
+		if oldest == nil {
+			return
+		}
+		vc.removeLocked(oldest)
+	}
+}
@@ -0,0 +1,111 @@
+// Package metrics holds the Prometheus collectors exposed on /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// RequestsTotal counts HTTP requests by route, method and status.
+	RequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "floppa_api_requests_total",
+			Help: "Total HTTP requests handled, by route, method and status",
+		},
+		[]string{"route", "method", "status"},
+	)
+
+	// RequestDuration tracks handler latency by route and method.
+	RequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "floppa_api_request_duration_seconds",
+			Help:    "Request latency in seconds, by route and method",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"route", "method"},
+	)
+
+	// PocketBaseDuration tracks PocketBase upstream latency by operation.
+	PocketBaseDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "floppa_api_pocketbase_duration_seconds",
+			Help:    "PocketBase upstream request latency in seconds, by operation",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"operation"},
+	)
+
+	// PocketBaseErrors counts PocketBase upstream errors by status code
+	// ("network_error" for requests that never got a response).
+	PocketBaseErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "floppa_api_pocketbase_errors_total",
+			Help: "PocketBase upstream errors, by status code",
+		},
+		[]string{"status"},
+	)
+
+	// ImageBytesServed counts bytes of image data served, by route.
+	ImageBytesServed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "floppa_api_image_bytes_served_total",
+			Help: "Total image bytes served, by route",
+		},
+		[]string{"route"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		RequestsTotal,
+		RequestDuration,
+		PocketBaseDuration,
+		PocketBaseErrors,
+		ImageBytesServed,
+	)
+}
+
+// RegisterCacheStats exposes cumulative cache hit/miss counts, read from
+// getHits/getMisses at scrape time, as floppa_api_cache_hits_total and
+// floppa_api_cache_misses_total.
+func RegisterCacheStats(getHits, getMisses func() int64) {
+	prometheus.MustRegister(
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Name: "floppa_api_cache_hits_total",
+				Help: "Image cache hits",
+			},
+			func() float64 { return float64(getHits()) },
+		),
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Name: "floppa_api_cache_misses_total",
+				Help: "Image cache misses",
+			},
+			func() float64 { return float64(getMisses()) },
+		),
+	)
+}
+
+// RegisterViewCounterFailures exposes the batched view-counter's
+// cumulative flush-failure count, read from getFailures at scrape time,
+// as floppa_api_view_update_failures_total.
+func RegisterViewCounterFailures(getFailures func() int64) {
+	prometheus.MustRegister(
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Name: "floppa_api_view_update_failures_total",
+				Help: "Failed view-count flushes to PocketBase",
+			},
+			func() float64 { return float64(getFailures()) },
+		),
+	)
+}
+
+// Handler serves the Prometheus text exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
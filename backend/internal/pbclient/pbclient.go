@@ -0,0 +1,321 @@
+// Package pbclient is a small PocketBase REST API client. It handles
+// admin authentication and token refresh, retries transient upstream
+// failures with exponential backoff, and surfaces typed errors so callers
+// can react to "not found" or "unauthorized" without string-matching.
+package pbclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/okurka12/floppa-api/backend/internal/metrics"
+)
+
+// Typed errors callers can check for with errors.Is.
+var (
+	ErrNotFound     = errors.New("pbclient: record not found")
+	ErrUnauthorized = errors.New("pbclient: unauthorized")
+	ErrRateLimited  = errors.New("pbclient: rate limited")
+)
+
+// tokenLifetime is how long an admin auth token is assumed valid; it's
+// refreshed a bit before this elapses, and a 401/403 response also drops
+// it so the next request re-authenticates.
+const tokenLifetime = time.Hour
+
+// CatRecord mirrors the subset of a PocketBase collection record this
+// client cares about.
+type CatRecord struct {
+	ID    string `json:"id"`
+	Image string `json:"image"`
+	Views int    `json:"views"`
+}
+
+type randomRecordsResponse struct {
+	Items []CatRecord `json:"items"`
+}
+
+type collectionStats struct {
+	TotalItems int `json:"totalItems"`
+}
+
+type authResponse struct {
+	Token string `json:"token"`
+}
+
+// Client talks to a single PocketBase instance, optionally authenticating
+// as an admin so it can write to collections whose update rule is locked
+// down to admins only.
+type Client struct {
+	baseURL       string
+	adminEmail    string
+	adminPassword string
+	maxRetries    int
+	httpClient    *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// New builds a Client for baseURL. adminEmail/adminPassword may be left
+// empty if nothing the caller does requires admin auth. maxRetries bounds
+// the backoff retries of a single request on 5xx, 429, or network errors.
+func New(baseURL, adminEmail, adminPassword string, maxRetries int) *Client {
+	return &Client{
+		baseURL:       baseURL,
+		adminEmail:    adminEmail,
+		adminPassword: adminPassword,
+		maxRetries:    maxRetries,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// RandomImage fetches one random record from collection, optionally
+// narrowed by filter, and downloads its image.
+func (c *Client) RandomImage(ctx context.Context, collection, filter string) ([]byte, CatRecord, error) {
+	reqURL := fmt.Sprintf("%s/api/collections/%s/records?perPage=1&sort=@random", c.baseURL, collection)
+	if filter != "" {
+		reqURL += "&filter=" + url.QueryEscape(filter)
+	}
+
+	resp, err := c.do(ctx, "GET", reqURL, nil, "random_record")
+	if err != nil {
+		return nil, CatRecord{}, fmt.Errorf("failed to fetch random record: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var randomResp randomRecordsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&randomResp); err != nil {
+		return nil, CatRecord{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(randomResp.Items) == 0 {
+		return nil, CatRecord{}, fmt.Errorf("no cat records found in collection")
+	}
+
+	cat := randomResp.Items[0]
+	if cat.Image == "" {
+		return nil, CatRecord{}, fmt.Errorf("record has no image field")
+	}
+
+	resp, err = c.do(ctx, "GET", fmt.Sprintf("%s/api/files/%s/%s/%s", c.baseURL, collection, cat.ID, cat.Image), nil, "file_download")
+	if err != nil {
+		return nil, CatRecord{}, fmt.Errorf("failed to download image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	imageData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, CatRecord{}, fmt.Errorf("failed to read image data: %w", err)
+	}
+
+	return imageData, cat, nil
+}
+
+// Count returns how many records in collection match filter.
+func (c *Client) Count(ctx context.Context, collection, filter string) (int, error) {
+	reqURL := fmt.Sprintf("%s/api/collections/%s/records?perPage=1", c.baseURL, collection)
+	if filter != "" {
+		reqURL += "&filter=" + url.QueryEscape(filter)
+	}
+
+	resp, err := c.do(ctx, "GET", reqURL, nil, "count")
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var stats collectionStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return stats.TotalItems, nil
+}
+
+// GetViews and SetViews implement viewcounter.Syncer against a record's
+// views field, authenticating as admin so they keep working once the
+// collection's update rule stops allowing anonymous writes.
+func (c *Client) GetViews(ctx context.Context, collection, recordID string) (int, error) {
+	resp, err := c.do(ctx, "GET", fmt.Sprintf("%s/api/collections/%s/records/%s", c.baseURL, collection, recordID), nil, "get_record_views")
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var record CatRecord
+	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return record.Views, nil
+}
+
+func (c *Client) SetViews(ctx context.Context, collection, recordID string, views int) error {
+	bodyBytes, err := json.Marshal(map[string]int{"views": views})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	resp, err := c.do(ctx, "PATCH", fmt.Sprintf("%s/api/collections/%s/records/%s", c.baseURL, collection, recordID), bodyBytes, "set_record_views")
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+// do executes one logical request against PocketBase, retrying with
+// exponential backoff on 5xx, 429, and network errors up to maxRetries
+// times. body, when non-nil, is sent as a JSON request body and resent
+// unchanged on every retry.
+func (c *Client) do(ctx context.Context, method, reqURL string, body []byte, operation string) (*http.Response, error) {
+	if err := c.ensureToken(ctx); err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := 200 * time.Millisecond * time.Duration(uint(1)<<uint(attempt-1))
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		var bodyReader io.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, reqURL, bodyReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token := c.authToken(); token != "" {
+			req.Header.Set("Authorization", token)
+		}
+
+		start := time.Now()
+		resp, err := c.httpClient.Do(req)
+		metrics.PocketBaseDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.PocketBaseErrors.WithLabelValues("network_error").Inc()
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		metrics.PocketBaseErrors.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return nil, ErrNotFound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			c.invalidateToken()
+			return nil, ErrUnauthorized
+		case http.StatusTooManyRequests:
+			lastErr = ErrRateLimited
+		default:
+			if resp.StatusCode >= 500 {
+				lastErr = fmt.Errorf("API error %d: %s", resp.StatusCode, string(respBody))
+				break
+			}
+			return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(respBody))
+		}
+	}
+
+	return nil, lastErr
+}
+
+func (c *Client) authToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *Client) invalidateToken() {
+	c.mu.Lock()
+	c.token = ""
+	c.tokenExpiry = time.Time{}
+	c.mu.Unlock()
+}
+
+// ensureToken authenticates as admin if credentials are configured and no
+// unexpired token is cached. A no-op when no admin credentials were given,
+// so Client keeps working against collections that allow anonymous reads.
+func (c *Client) ensureToken(ctx context.Context) error {
+	if c.adminEmail == "" && c.adminPassword == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	needsAuth := c.token == "" || time.Now().After(c.tokenExpiry)
+	c.mu.Unlock()
+	if !needsAuth {
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"identity": c.adminEmail,
+		"password": c.adminPassword,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal auth payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/admins/auth-with-password", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create auth request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	metrics.PocketBaseDuration.WithLabelValues("admin_auth").Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.PocketBaseErrors.WithLabelValues("network_error").Inc()
+		return fmt.Errorf("admin auth request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		metrics.PocketBaseErrors.WithLabelValues(strconv.Itoa(resp.StatusCode)).Inc()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return fmt.Errorf("%w: %s", ErrUnauthorized, string(body))
+		}
+		return fmt.Errorf("admin auth error %d: %s", resp.StatusCode, string(body))
+	}
+
+	var auth authResponse
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return fmt.Errorf("failed to decode auth response: %w", err)
+	}
+
+	c.mu.Lock()
+	c.token = auth.Token
+	c.tokenExpiry = time.Now().Add(tokenLifetime - 5*time.Minute)
+	c.mu.Unlock()
+
+	return nil
+}
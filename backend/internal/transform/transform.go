@@ -0,0 +1,121 @@
+// Package transform resizes and re-encodes images on the fly, so a single
+// cached source image can be served as whatever thumbnail variant a
+// client asked for.
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+
+	"golang.org/x/image/draw"
+
+	"github.com/chai2010/webp"
+)
+
+// defaultQuality is used when Options.Quality is unset.
+const defaultQuality = 85
+
+// Options describes a requested thumbnail variant. Width and Height of 0
+// mean "keep the source's size in that dimension"; if exactly one is set
+// the other is derived to preserve aspect ratio.
+type Options struct {
+	Width   int
+	Height  int
+	Format  string // "jpeg", "png", or "webp"; empty keeps the source format
+	Quality int    // 1-100, meaningful for jpeg/webp only; 0 means default
+}
+
+// Apply decodes src, resizes it per opts, re-encodes it, and returns the
+// result along with its Content-Type.
+func Apply(src []byte, opts Options) ([]byte, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	if opts.Width > 0 || opts.Height > 0 {
+		img = resize(img, opts.Width, opts.Height)
+	}
+
+	outFormat := opts.Format
+	if outFormat == "" {
+		outFormat = format
+	}
+
+	quality := opts.Quality
+	if quality <= 0 {
+		quality = defaultQuality
+	}
+
+	return encode(img, outFormat, quality)
+}
+
+// resize scales img to w x h, deriving whichever of w/h is 0 from the
+// source's aspect ratio.
+func resize(img image.Image, w, h int) image.Image {
+	bounds := img.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+
+	if w == 0 {
+		w = sw * h / sh
+	}
+	if h == 0 {
+		h = sh * w / sw
+	}
+	if w <= 0 || h <= 0 {
+		return img
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	lanczos.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
+
+// lanczos is a 3-lobe Lanczos resampling kernel. golang.org/x/image/draw
+// ships bilinear and Catmull-Rom kernels but not Lanczos, so it's built
+// as a draw.Kernel directly from the sinc-based Lanczos definition.
+var lanczos = draw.Kernel{
+	Support: 3,
+	At: func(x float64) float64 {
+		x = math.Abs(x)
+		if x >= 3 {
+			return 0
+		}
+		if x < 1e-8 {
+			return 1
+		}
+		piX := math.Pi * x
+		return 3 * math.Sin(piX) * math.Sin(piX/3) / (piX * piX)
+	},
+}
+
+func encode(img image.Image, format string, quality int) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	switch format {
+	case "jpeg", "jpg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, "", fmt.Errorf("failed to encode jpeg: %w", err)
+		}
+		return buf.Bytes(), "image/jpeg", nil
+
+	case "png":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", fmt.Errorf("failed to encode png: %w", err)
+		}
+		return buf.Bytes(), "image/png", nil
+
+	case "webp":
+		if err := webp.Encode(&buf, img, &webp.Options{Quality: float32(quality)}); err != nil {
+			return nil, "", fmt.Errorf("failed to encode webp: %w", err)
+		}
+		return buf.Bytes(), "image/webp", nil
+
+	default:
+		return nil, "", fmt.Errorf("unsupported output format %q", format)
+	}
+}
@@ -0,0 +1,204 @@
+// Package viewcounter batches view-count increments in memory and
+// periodically flushes them to a backing store with a single
+// read-modify-write per record, instead of one write per hit.
+package viewcounter
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Syncer reads and writes a record's views field. Implementations are
+// expected to retry transient failures themselves if desired; Counter
+// additionally retries the whole read-modify-write on error.
+type Syncer interface {
+	GetViews(ctx context.Context, collection, recordID string) (int, error)
+	SetViews(ctx context.Context, collection, recordID string, views int) error
+}
+
+type recordKey struct {
+	collection string
+	recordID   string
+}
+
+// Counter accumulates per-record view deltas in memory and flushes them
+// to a Syncer on a timer, or immediately once a record's delta crosses
+// deltaThreshold. This trades exact real-time counts for far fewer
+// backing-store writes and avoids the lost-update race of every hit
+// doing its own read-modify-write PATCH.
+type Counter struct {
+	syncer         Syncer
+	flushInterval  time.Duration
+	deltaThreshold int
+	maxRetries     int
+
+	mu      sync.Mutex
+	pending map[recordKey]int
+
+	// flushLocks serializes the read-modify-write in syncWithRetry per
+	// record, so a threshold-triggered flushOne can't race a concurrent
+	// FlushAll (or another threshold trigger) for the same record and lose
+	// one side's delta.
+	flushLocks map[recordKey]*sync.Mutex
+
+	failures int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New builds a Counter. flushInterval controls how often Run flushes all
+// pending deltas; deltaThreshold (0 disables) flushes a single record as
+// soon as its pending delta reaches it; maxRetries bounds the backoff
+// retries of a single flush.
+func New(syncer Syncer, flushInterval time.Duration, deltaThreshold, maxRetries int) *Counter {
+	return &Counter{
+		syncer:         syncer,
+		flushInterval:  flushInterval,
+		deltaThreshold: deltaThreshold,
+		maxRetries:     maxRetries,
+		pending:        make(map[recordKey]int),
+		flushLocks:     make(map[recordKey]*sync.Mutex),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+}
+
+// Increment records one view for a record. It never blocks on the
+// network; the delta is written back by Run, an explicit FlushAll, or,
+// once it reaches deltaThreshold, a background flush of that record.
+func (c *Counter) Increment(collection, recordID string) {
+	k := recordKey{collection, recordID}
+
+	c.mu.Lock()
+	c.pending[k]++
+	delta := c.pending[k]
+	c.mu.Unlock()
+
+	if c.deltaThreshold > 0 && delta >= c.deltaThreshold {
+		go c.flushOne(context.Background(), k)
+	}
+}
+
+// Run flushes pending deltas every flushInterval until Stop is called.
+// Intended to be run in its own goroutine.
+func (c *Counter) Run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.FlushAll(context.Background())
+		}
+	}
+}
+
+// Stop ends the Run loop and flushes any remaining pending deltas before
+// returning, so a graceful shutdown doesn't lose counted views.
+func (c *Counter) Stop(ctx context.Context) {
+	close(c.stop)
+	<-c.done
+	c.FlushAll(ctx)
+}
+
+// FlushAll writes every currently pending delta back through the Syncer.
+func (c *Counter) FlushAll(ctx context.Context) {
+	c.mu.Lock()
+	keys := make([]recordKey, 0, len(c.pending))
+	for k := range c.pending {
+		keys = append(keys, k)
+	}
+	c.mu.Unlock()
+
+	for _, k := range keys {
+		c.flushOne(ctx, k)
+	}
+}
+
+// flushOne writes back the pending delta for one record. On failure the
+// delta is added back to pending so the next flush retries it instead of
+// losing the increments.
+//
+// The per-record flushLock is held across the whole read-modify-write so
+// an overlapping flush of the same record (e.g. a threshold trigger racing
+// a ticker FlushAll) waits instead of stepping on this one's SetViews.
+func (c *Counter) flushOne(ctx context.Context, k recordKey) {
+	lock := c.flushLockFor(k)
+	lock.Lock()
+	defer lock.Unlock()
+
+	c.mu.Lock()
+	delta := c.pending[k]
+	if delta == 0 {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.pending, k)
+	c.mu.Unlock()
+
+	if err := c.syncWithRetry(ctx, k, delta); err != nil {
+		atomic.AddInt64(&c.failures, 1)
+		log.Printf("viewcounter: failed to flush %d views for %s/%s: %v", delta, k.collection, k.recordID, err)
+		c.mu.Lock()
+		c.pending[k] += delta
+		c.mu.Unlock()
+	}
+}
+
+// Failures reports how many flush attempts have ultimately failed (after
+// exhausting retries), exposed through the /metrics endpoint.
+func (c *Counter) Failures() int64 { return atomic.LoadInt64(&c.failures) }
+
+// flushLockFor returns the mutex that serializes flushes of k, creating it
+// on first use.
+func (c *Counter) flushLockFor(k recordKey) *sync.Mutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lock, ok := c.flushLocks[k]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.flushLocks[k] = lock
+	}
+	return lock
+}
+
+// syncWithRetry does the GET-add-PATCH for one record, retrying with
+// exponential backoff on error.
+func (c *Counter) syncWithRetry(ctx context.Context, k recordKey, delta int) error {
+	var lastErr error
+
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := 200 * time.Millisecond * time.Duration(uint(1)<<uint(attempt-1))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+
+		views, err := c.syncer.GetViews(ctx, k.collection, k.recordID)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if err := c.syncer.SetViews(ctx, k.collection, k.recordID, views+delta); err != nil {
+			lastErr = err
+			continue
+		}
+
+		return nil
+	}
+
+	return lastErr
+}
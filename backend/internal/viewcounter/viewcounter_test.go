@@ -0,0 +1,153 @@
+package viewcounter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSyncer is an in-memory Syncer whose GetViews/SetViews can be made to
+// fail on demand, so tests can exercise Counter's retry/requeue behavior.
+type fakeSyncer struct {
+	mu    sync.Mutex
+	views map[recordKey]int
+	fail  bool
+
+	// blockGet and getStarted, when set, let a test pause a GetViews call
+	// after it has read the current value but before returning it, so a
+	// second flush of the same record can be made to interleave.
+	blockGet   chan struct{}
+	getStarted chan struct{}
+}
+
+func newFakeSyncer() *fakeSyncer {
+	return &fakeSyncer{views: make(map[recordKey]int)}
+}
+
+func (f *fakeSyncer) GetViews(ctx context.Context, collection, recordID string) (int, error) {
+	f.mu.Lock()
+	fail := f.fail
+	views := f.views[recordKey{collection, recordID}]
+	block, started := f.blockGet, f.getStarted
+	f.mu.Unlock()
+
+	if started != nil {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+	}
+	if block != nil {
+		<-block
+	}
+
+	if fail {
+		return 0, errors.New("simulated failure")
+	}
+	return views, nil
+}
+
+func (f *fakeSyncer) SetViews(ctx context.Context, collection, recordID string, views int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return errors.New("simulated failure")
+	}
+	f.views[recordKey{collection, recordID}] = views
+	return nil
+}
+
+func (f *fakeSyncer) viewsFor(collection, recordID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.views[recordKey{collection, recordID}]
+}
+
+func TestCounterConcurrentIncrementsFlushWithoutLoss(t *testing.T) {
+	syncer := newFakeSyncer()
+	c := New(syncer, time.Hour, 0, 0)
+
+	const n = 100
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			c.Increment("cats", "rec1")
+		}()
+	}
+	wg.Wait()
+
+	c.FlushAll(context.Background())
+
+	if got := syncer.viewsFor("cats", "rec1"); got != n {
+		t.Fatalf("got %d views after %d concurrent increments, want %d", got, n, n)
+	}
+}
+
+func TestCounterRequeuesPendingDeltaOnSyncFailure(t *testing.T) {
+	syncer := newFakeSyncer()
+	syncer.fail = true
+	c := New(syncer, time.Hour, 0, 0)
+
+	c.Increment("cats", "rec1")
+	c.FlushAll(context.Background())
+
+	if got := c.Failures(); got != 1 {
+		t.Fatalf("Failures() = %d, want 1", got)
+	}
+
+	syncer.mu.Lock()
+	syncer.fail = false
+	syncer.mu.Unlock()
+
+	c.FlushAll(context.Background())
+
+	if got := syncer.viewsFor("cats", "rec1"); got != 1 {
+		t.Fatalf("got %d views after recovery, want 1 (the increment should not have been lost)", got)
+	}
+}
+
+func TestCounterConcurrentFlushesOfSameRecordDontLoseUpdates(t *testing.T) {
+	syncer := newFakeSyncer()
+	c := New(syncer, time.Hour, 0, 0)
+
+	c.Increment("cats", "rec1")
+
+	block := make(chan struct{})
+	started := make(chan struct{}, 1)
+	syncer.mu.Lock()
+	syncer.blockGet = block
+	syncer.getStarted = started
+	syncer.mu.Unlock()
+
+	firstDone := make(chan struct{})
+	go func() {
+		defer close(firstDone)
+		c.FlushAll(context.Background())
+	}()
+
+	<-started // wait until the first flush has read the stale value and paused
+
+	c.Increment("cats", "rec1")
+	secondDone := make(chan struct{})
+	go func() {
+		defer close(secondDone)
+		c.FlushAll(context.Background())
+	}()
+
+	// Give the second flush a chance to race ahead before unblocking the
+	// first; without per-record serialization both would read the same
+	// stale value and the second's write would clobber the first's.
+	time.Sleep(20 * time.Millisecond)
+	close(block)
+
+	<-firstDone
+	<-secondDone
+
+	if got := syncer.viewsFor("cats", "rec1"); got != 2 {
+		t.Fatalf("got %d views after two concurrent flushes of one record, want 2 (an update was lost)", got)
+	}
+}
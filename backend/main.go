@@ -1,23 +1,98 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/okurka12/floppa-api/backend/internal/cache"
+	"github.com/okurka12/floppa-api/backend/internal/metrics"
+	"github.com/okurka12/floppa-api/backend/internal/pbclient"
+	"github.com/okurka12/floppa-api/backend/internal/transform"
+	"github.com/okurka12/floppa-api/backend/internal/viewcounter"
 )
 
+// accessLogger emits one structured JSON line per request, replacing
+// Gin's plain-text default logger.
+var accessLogger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// ImageSource describes one named collection of images the server can
+// serve from, either a local directory or a PocketBase collection.
+type ImageSource struct {
+	Name       string  `json:"name"`
+	Backend    string  `json:"backend"` // "local_dir" or "pocketbase_collection"
+	Dir        string  `json:"dir,omitempty"`
+	Collection string  `json:"collection,omitempty"`
+	Filter     string  `json:"filter,omitempty"`
+	Weight     float64 `json:"weight"`
+}
+
+// CacheConfig configures the on-disk LRU cache and prefetcher in front of
+// PocketBase-backed sources, plus the variant cache for resized/transcoded
+// thumbnails. Dir left empty disables both caches entirely.
+type CacheConfig struct {
+	Dir               string `json:"dir"`
+	MaxBytes          int64  `json:"max_bytes"`
+	MaxEntries        int    `json:"max_entries"`
+	WarmPerSource     int    `json:"warm_per_source"`
+	VariantMaxBytes   int64  `json:"variant_max_bytes"`
+	VariantMaxEntries int    `json:"variant_max_entries"`
+}
+
+// AdminConfig guards the admin-only endpoints with a bearer token.
+type AdminConfig struct {
+	Token string `json:"token"`
+}
+
+// ViewCounterConfig tunes the batched view-count flusher.
+type ViewCounterConfig struct {
+	FlushIntervalSeconds int `json:"flush_interval_seconds"`
+	DeltaThreshold       int `json:"delta_threshold"`
+	MaxRetries           int `json:"max_retries"`
+}
+
+func defaultViewCounterConfig() ViewCounterConfig {
+	return ViewCounterConfig{FlushIntervalSeconds: 30, DeltaThreshold: 50, MaxRetries: 3}
+}
+
 type Config struct {
-	PocketBaseURL string `json:"pocketbase_url"`
+	PocketBaseURL           string            `json:"pocketbase_url"`
+	PocketBaseAdminEmail    string            `json:"pocketbase_admin_email"`
+	PocketBaseAdminPassword string            `json:"pocketbase_admin_password"`
+	PocketBaseMaxRetries    int               `json:"pocketbase_max_retries"`
+	Sources                 []ImageSource     `json:"sources"`
+	Cache                   CacheConfig       `json:"cache"`
+	Admin                   AdminConfig       `json:"admin"`
+	ViewCounter             ViewCounterConfig `json:"view_counter"`
+}
+
+// defaultPocketBaseMaxRetries bounds backoff retries on a PocketBase
+// request when config.json doesn't set pocketbase_max_retries.
+const defaultPocketBaseMaxRetries = 3
+
+// defaultSources preserves the original /floppapi and /macka behavior for
+// deployments whose config.json doesn't list sources explicitly yet.
+func defaultSources() []ImageSource {
+	return []ImageSource{
+		{Name: "floppapi", Backend: "local_dir", Dir: "./floppa", Weight: 1},
+		{Name: "macka", Backend: "pocketbase_collection", Collection: "macky", Weight: 1},
+	}
 }
 
 func loadConfig() (*Config, error) {
@@ -52,227 +127,591 @@ func loadConfig() (*Config, error) {
 		return nil, fmt.Errorf("failed to decode config.json: %w", err)
 	}
 
+	if len(config.Sources) == 0 {
+		config.Sources = defaultSources()
+	}
+	if config.ViewCounter == (ViewCounterConfig{}) {
+		config.ViewCounter = defaultViewCounterConfig()
+	}
+	if config.PocketBaseMaxRetries == 0 {
+		config.PocketBaseMaxRetries = defaultPocketBaseMaxRetries
+	}
+
 	return &config, nil
 }
 
-func main() {
-	config, err := loadConfig()
+// sourceRouter resolves named image sources and picks among them by
+// weight for /img/random.
+type sourceRouter struct {
+	config      *Config
+	sources     map[string]ImageSource
+	cache       *cache.Cache
+	variants    *cache.VariantCache
+	prefetchers []*cache.Prefetcher
+	pbClient    *pbclient.Client
+	viewCounter *viewcounter.Counter
+}
+
+func newSourceRouter(config *Config) (*sourceRouter, error) {
+	index := make(map[string]ImageSource, len(config.Sources))
+	for _, s := range config.Sources {
+		index[s.Name] = s
+	}
+
+	sr := &sourceRouter{config: config, sources: index}
+	sr.pbClient = pbclient.New(config.PocketBaseURL, config.PocketBaseAdminEmail, config.PocketBaseAdminPassword, config.PocketBaseMaxRetries)
+
+	sr.viewCounter = viewcounter.New(
+		sr.pbClient,
+		time.Duration(config.ViewCounter.FlushIntervalSeconds)*time.Second,
+		config.ViewCounter.DeltaThreshold,
+		config.ViewCounter.MaxRetries,
+	)
+	metrics.RegisterViewCounterFailures(sr.viewCounter.Failures)
+	go sr.viewCounter.Run()
+
+	if config.Cache.Dir == "" {
+		return sr, nil
+	}
+
+	c, err := cache.New(config.Cache.Dir, config.Cache.MaxBytes, config.Cache.MaxEntries)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		return nil, err
 	}
+	sr.cache = c
+	metrics.RegisterCacheStats(sr.cache.Hits, sr.cache.Misses)
 
-	r := gin.Default()
+	variants, err := cache.NewVariantCache(filepath.Join(config.Cache.Dir, "variants"), config.Cache.VariantMaxBytes, config.Cache.VariantMaxEntries)
+	if err != nil {
+		return nil, err
+	}
+	sr.variants = variants
 
-	// Serve frontend static files
-	r.Static("/assets", "./frontend/dist/assets")
-	r.StaticFile("/", "./frontend/dist/index.html")
+	if config.Cache.WarmPerSource > 0 {
+		for _, s := range config.Sources {
+			if s.Backend != "pocketbase_collection" {
+				continue
+			}
 
-	r.GET("/floppapi", func(c *gin.Context) {
-		imagePath, err := getRandomImage()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			source := s
+			fetch := func(ctx context.Context) ([]byte, cache.Entry, error) {
+				data, cat, err := sr.pbClient.RandomImage(ctx, source.Collection, source.Filter)
+				if err != nil {
+					return nil, cache.Entry{}, err
+				}
+				return data, cache.Entry{
+					RecordID:    cat.ID,
+					Filename:    cat.Image,
+					ContentType: "image/jpeg",
+				}, nil
+			}
+
+			prefetcher := cache.NewPrefetcher(sr.cache, source.Collection, config.Cache.WarmPerSource, 5*time.Second, fetch)
+			sr.prefetchers = append(sr.prefetchers, prefetcher)
+			go prefetcher.Run(context.Background())
 		}
+	}
 
-		c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
-		c.Header("Pragma", "no-cache")
-		c.Header("Expires", "0")
+	return sr, nil
+}
 
-		c.File(imagePath)
-	})
+func (sr *sourceRouter) source(name string) (ImageSource, bool) {
+	s, ok := sr.sources[name]
+	return s, ok
+}
 
-	r.GET("/macka", func(c *gin.Context) {
-		imageData, cat, err := getRandomImageFromCollection(context.Background(), "macky", config.PocketBaseURL)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+// randomSourceName picks a source name at random, weighted by each
+// source's configured Weight.
+func (sr *sourceRouter) randomSourceName() (string, error) {
+	if len(sr.sources) == 0 {
+		return "", fmt.Errorf("no image sources configured")
+	}
+
+	var total float64
+	for _, s := range sr.sources {
+		total += s.Weight
+	}
+	if total <= 0 {
+		return "", fmt.Errorf("no image sources with positive weight configured")
+	}
+
+	pick := rand.Float64() * total
+	for _, s := range sr.sources {
+		pick -= s.Weight
+		if pick <= 0 {
+			return s.Name, nil
 		}
+	}
+
+	// Floating point rounding can leave a tiny positive remainder; fall
+	// back to an arbitrary configured source rather than erroring out.
+	for _, s := range sr.sources {
+		return s.Name, nil
+	}
+	return "", fmt.Errorf("no image sources configured")
+}
 
-		// Update views in background to not block response
-		go func(recordID string, currentViews int) {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
+// fetchImage resolves a source by name and returns one random image from
+// it, along with a stable identifier for that image (used to key the
+// variant cache), whether it was served from cache, and how long the
+// PocketBase round trip took (zero for local_dir sources and cache
+// hits). tag, if non-empty, is folded into the PocketBase filter for
+// pocketbase_collection sources. trackViews controls whether a view-count
+// update is fired off for PocketBase-backed sources.
+func (sr *sourceRouter) fetchImage(ctx context.Context, name, tag string, trackViews bool) ([]byte, string, string, bool, time.Duration, error) {
+	source, ok := sr.source(name)
+	if !ok {
+		return nil, "", "", false, 0, fmt.Errorf("unknown image source %q", name)
+	}
 
-			if err := updateRecordViews(ctx, config.PocketBaseURL, "macky", recordID, currentViews); err != nil {
-				log.Printf("Failed to update views for record %s: %v", recordID, err)
+	switch source.Backend {
+	case "local_dir":
+		imagePath, err := getRandomImage(source.Dir)
+		if err != nil {
+			return nil, "", "", false, 0, err
+		}
+		data, err := os.ReadFile(imagePath)
+		if err != nil {
+			return nil, "", "", false, 0, fmt.Errorf("failed to read image file: %w", err)
+		}
+		return data, contentTypeForFile(imagePath), filepath.Base(imagePath), false, 0, nil
+
+	case "pocketbase_collection":
+		// Warm cache entries were prefetched without a tag filter, so only
+		// consult the cache for untagged requests; tagged ones always hit
+		// PocketBase directly.
+		if sr.cache != nil && tag == "" {
+			if data, entry, ok := sr.cache.TakeWarm(source.Collection); ok {
+				if trackViews && entry.RecordID != "" {
+					sr.viewCounter.Increment(source.Collection, entry.RecordID)
+				}
+				return data, entry.ContentType, entry.RecordID, true, 0, nil
 			}
-		}(cat.ID, cat.Views)
+		}
 
-		c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
-		c.Header("Pragma", "no-cache")
-		c.Header("Expires", "0")
+		filter := combineFilter(source.Filter, tag)
+		start := time.Now()
+		data, cat, err := sr.pbClient.RandomImage(ctx, source.Collection, filter)
+		upstreamLatency := time.Since(start)
+		if err != nil {
+			return nil, "", "", false, upstreamLatency, err
+		}
 
-		c.Data(http.StatusOK, "image/jpeg", imageData)
-	})
+		if trackViews && cat.ID != "" {
+			sr.viewCounter.Increment(source.Collection, cat.ID)
+		}
 
-	r.GET("/macka/count", func(c *gin.Context) {
-		count, err := getCollectionCount(context.Background(), config.PocketBaseURL, "macky")
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+		// Persist untagged fetches so the warm set is topped up even with
+		// prefetching disabled (warm_per_source == 0); tagged fetches are
+		// left out since the warm set isn't keyed by tag and TakeWarm above
+		// only ever consults it for untagged requests.
+		if sr.cache != nil && tag == "" && cat.ID != "" {
+			entry := cache.Entry{
+				Collection:  source.Collection,
+				RecordID:    cat.ID,
+				Filename:    cat.Image,
+				ContentType: "image/jpeg",
+				FetchedAt:   time.Now(),
+			}
+			if err := sr.cache.Put(entry, data); err != nil {
+				log.Printf("cache: failed to store %s/%s: %v", source.Collection, cat.ID, err)
+			}
 		}
 
-		c.JSON(http.StatusOK, gin.H{"count": count})
-	})
+		return data, "image/jpeg", cat.ID, false, upstreamLatency, nil
 
-	log.Println("Server starting on :8080")
-	r.Run(":8080")
+	default:
+		return nil, "", "", false, 0, fmt.Errorf("unsupported backend %q for source %q", source.Backend, name)
+	}
 }
 
-func getRandomImage() (string, error) {
-	floppaDir := "./floppa"
+// variant returns data re-encoded per opts, serving from and populating
+// the variant cache when one is configured so the same transform isn't
+// redone on every request for a given (source, id, opts).
+func (sr *sourceRouter) variant(source, id string, data []byte, opts transform.Options) ([]byte, string, error) {
+	if sr.variants == nil || id == "" {
+		return transform.Apply(data, opts)
+	}
 
-	files, err := os.ReadDir(floppaDir)
-	if err != nil {
-		return "", fmt.Errorf("failed to read floppa directory: %v", err)
+	key := variantKey(source, id, opts)
+	if cached, entry, ok := sr.variants.Get(key); ok {
+		return cached, entry.ContentType, nil
 	}
 
-	var imageFiles []string
-	for _, file := range files {
-		if !file.IsDir() && isImageFile(file.Name()) {
-			imageFiles = append(imageFiles, file.Name())
-		}
+	out, contentType, err := transform.Apply(data, opts)
+	if err != nil {
+		return nil, "", err
 	}
 
-	if len(imageFiles) == 0 {
-		return "", fmt.Errorf("no image files found in floppa directory")
+	if err := sr.variants.Put(key, cache.VariantEntry{ContentType: contentType}, out); err != nil {
+		log.Printf("cache: failed to store variant %q: %v", key, err)
 	}
+	return out, contentType, nil
+}
 
-	randomIndex := rand.Intn(len(imageFiles))
-	selectedImage := imageFiles[randomIndex]
+func (sr *sourceRouter) count(ctx context.Context, name string) (int, error) {
+	source, ok := sr.source(name)
+	if !ok {
+		return 0, fmt.Errorf("unknown image source %q", name)
+	}
 
-	return filepath.Join(floppaDir, selectedImage), nil
+	switch source.Backend {
+	case "local_dir":
+		return countImagesInDir(source.Dir)
+	case "pocketbase_collection":
+		return sr.pbClient.Count(ctx, source.Collection, source.Filter)
+	default:
+		return 0, fmt.Errorf("unsupported backend %q for source %q", source.Backend, name)
+	}
 }
 
-type CatRecord struct {
-	ID    string `json:"id"`
-	Image string `json:"image"`
-	Views int    `json:"views"`
+// escapeFilterValue escapes backslashes and single quotes in a value
+// headed into a single-quoted PocketBase filter literal, so a tag like
+// "x') || (a=a" can't break out of the literal and inject filter logic.
+func escapeFilterValue(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return s
 }
 
-type RandomCatsResponse struct {
-	Items []CatRecord `json:"items"`
+// combineFilter ANDs a `?tag=` query param onto a source's configured base
+// filter, producing a PocketBase filter expression like
+// "(tags ~ 'cute') && (tags ~ 'funny')".
+func combineFilter(base, tag string) string {
+	if tag == "" {
+		return base
+	}
+	tagFilter := fmt.Sprintf("tags ~ '%s'", escapeFilterValue(tag))
+	if base == "" {
+		return tagFilter
+	}
+	return fmt.Sprintf("(%s) && (%s)", base, tagFilter)
 }
 
-func getRandomImageFromCollection(ctx context.Context, collectionName, pocketBaseURL string) ([]byte, CatRecord, error) {
+func setNoStoreHeaders(c *gin.Context) {
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("Expires", "0")
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/collections/%s/records?perPage=1&sort=@random", pocketBaseURL, collectionName), nil)
-	if err != nil {
-		return nil, CatRecord{}, fmt.Errorf("failed to create request: %w", err)
+// maxVariantDimension bounds ?w=/?h= so a single request can't force
+// transform.Apply to allocate an arbitrarily large decoded bitmap (a
+// 20000x20000 RGBA image is ~1.6GB) ahead of any auth or rate limiting.
+const maxVariantDimension = 4096
+
+// variantOptionsFromRequest builds transform.Options from the ?w=, ?h=,
+// ?fmt= and ?q= query params, falling back to webp when the client didn't
+// ask for a specific format but advertises support for it via Accept.
+// wantsTransform is false when the request is for the source image as-is.
+//
+// avif isn't supported: there's no pure-Go avif encoder on par with
+// image/jpeg, image/png, or chai2010/webp, so ?fmt=avif is rejected like
+// any other unrecognized format rather than silently falling back.
+func variantOptionsFromRequest(c *gin.Context) (opts transform.Options, wantsTransform bool, err error) {
+	if w := c.Query("w"); w != "" {
+		opts.Width, err = strconv.Atoi(w)
+		if err != nil || opts.Width <= 0 || opts.Width > maxVariantDimension {
+			return transform.Options{}, false, fmt.Errorf("invalid w %q", w)
+		}
+		wantsTransform = true
 	}
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, CatRecord{}, fmt.Errorf("failed to fetch random record: %w", err)
+	if h := c.Query("h"); h != "" {
+		opts.Height, err = strconv.Atoi(h)
+		if err != nil || opts.Height <= 0 || opts.Height > maxVariantDimension {
+			return transform.Options{}, false, fmt.Errorf("invalid h %q", h)
+		}
+		wantsTransform = true
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, CatRecord{}, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	if q := c.Query("q"); q != "" {
+		opts.Quality, err = strconv.Atoi(q)
+		if err != nil || opts.Quality <= 0 || opts.Quality > 100 {
+			return transform.Options{}, false, fmt.Errorf("invalid q %q", q)
+		}
+		wantsTransform = true
 	}
 
-	var randomResp RandomCatsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&randomResp); err != nil {
-		return nil, CatRecord{}, fmt.Errorf("failed to decode response: %w", err)
+	opts.Format = c.Query("fmt")
+	switch opts.Format {
+	case "":
+		if strings.Contains(c.GetHeader("Accept"), "image/webp") {
+			opts.Format = "webp"
+			wantsTransform = true
+		}
+	case "jpeg", "jpg", "png", "webp":
+		wantsTransform = true
+	default:
+		return transform.Options{}, false, fmt.Errorf("unsupported fmt %q", opts.Format)
 	}
 
-	if len(randomResp.Items) == 0 {
-		return nil, CatRecord{}, fmt.Errorf("no cat records found in collection")
-	}
+	return opts, wantsTransform, nil
+}
 
-	cat := randomResp.Items[0]
-	if cat.Image == "" {
-		return nil, CatRecord{}, fmt.Errorf("record has no image field")
-	}
+// variantKey identifies one (source, id, opts) variant, both as the
+// variant cache's storage key and as the input to its ETag, so the two
+// can never drift apart.
+func variantKey(source, id string, opts transform.Options) string {
+	return fmt.Sprintf("%s/%s/%dx%d.%s.q%d", source, id, opts.Width, opts.Height, opts.Format, opts.Quality)
+}
+
+// variantETag derives a strong ETag from a variant's identity rather than
+// hashing its bytes, so revalidation stays cheap even for large images.
+func variantETag(source, id string, opts transform.Options) string {
+	sum := sha256.Sum256([]byte(variantKey(source, id, opts)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
 
-	req, err = http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/files/%s/%s/%s", pocketBaseURL, collectionName, cat.ID, cat.Image), nil)
+func main() {
+	config, err := loadConfig()
 	if err != nil {
-		return nil, CatRecord{}, fmt.Errorf("failed to create image request: %w", err)
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	resp, err = client.Do(req)
+	router, err := newSourceRouter(config)
 	if err != nil {
-		return nil, CatRecord{}, fmt.Errorf("failed to download image: %w", err)
+		log.Fatalf("Failed to initialize image source router: %v", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, CatRecord{}, fmt.Errorf("image download error %d: %s", resp.StatusCode, string(body))
+	r := gin.New()
+	r.Use(gin.Recovery(), requestObservability())
+
+	// Serve frontend static files
+	r.Static("/assets", "./frontend/dist/assets")
+	r.StaticFile("/", "./frontend/dist/index.html")
+
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// Legacy routes, kept as aliases onto the "floppapi"/"macka" sources
+	// so existing clients keep working.
+	r.GET("/floppapi", func(c *gin.Context) {
+		serveImage(c, router, "floppapi", false)
+	})
+	r.GET("/macka", func(c *gin.Context) {
+		serveImage(c, router, "macka", true)
+	})
+	r.GET("/macka/count", func(c *gin.Context) {
+		serveCount(c, router, "macka")
+	})
+
+	// Generic routes across all configured image sources.
+	r.GET("/img/:source", func(c *gin.Context) {
+		serveImage(c, router, c.Param("source"), true)
+	})
+	r.GET("/img/:source/count", func(c *gin.Context) {
+		serveCount(c, router, c.Param("source"))
+	})
+	r.GET("/img/random", func(c *gin.Context) {
+		name, err := router.randomSourceName()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		serveImage(c, router, name, true)
+	})
+
+	r.POST("/admin/cache/purge", adminAuth(config.Admin.Token), func(c *gin.Context) {
+		var body struct {
+			Collection string `json:"collection"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil || body.Collection == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "collection is required"})
+			return
+		}
+		if router.cache == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "cache is not configured"})
+			return
+		}
+
+		purged := router.cache.Purge(body.Collection)
+		c.JSON(http.StatusOK, gin.H{"purged": purged})
+	})
+
+	srv := &http.Server{Addr: ":8080", Handler: r}
+
+	go func() {
+		log.Println("Server starting on :8080")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	stopSignal := make(chan os.Signal, 1)
+	signal.Notify(stopSignal, syscall.SIGINT, syscall.SIGTERM)
+	<-stopSignal
+
+	log.Println("Shutting down: no longer accepting new requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
 	}
 
-	imageData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, CatRecord{}, fmt.Errorf("failed to read image data: %w", err)
+	log.Println("Flushing pending view counts")
+	router.viewCounter.Stop(shutdownCtx)
+
+	log.Println("Stopping cache prefetchers")
+	for _, p := range router.prefetchers {
+		p.Stop()
 	}
 
-	return imageData, cat, nil
+	log.Println("Shutdown complete")
 }
 
-type CollectionStats struct {
-	TotalItems int `json:"totalItems"`
-	TotalPages int `json:"totalPages"`
-	Page       int `json:"page"`
-	PerPage    int `json:"perPage"`
+var requestCounter int64
+
+// nextRequestID returns a cheap, process-unique request identifier; it
+// doesn't need to be globally unique, only useful for correlating a
+// request's log line and metrics.
+func nextRequestID() string {
+	return strconv.FormatInt(atomic.AddInt64(&requestCounter, 1), 36)
+}
+
+// requestObservability records per-route Prometheus metrics and emits one
+// structured JSON log line per request, replacing Gin's default logger.
+func requestObservability() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := nextRequestID()
+		c.Set("request_id", requestID)
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		status := c.Writer.Status()
+		latency := time.Since(start)
+
+		metrics.RequestsTotal.WithLabelValues(route, c.Request.Method, strconv.Itoa(status)).Inc()
+		metrics.RequestDuration.WithLabelValues(route, c.Request.Method).Observe(latency.Seconds())
+
+		cacheHit, _ := c.Get("cache_hit")
+		upstreamLatencyMs, _ := c.Get("upstream_latency_ms")
+
+		accessLogger.Info("request",
+			"request_id", requestID,
+			"route", route,
+			"method", c.Request.Method,
+			"status", status,
+			"latency_ms", latency.Milliseconds(),
+			"upstream_latency_ms", upstreamLatencyMs,
+			"cache_hit", cacheHit,
+		)
+	}
 }
 
-func getCollectionCount(ctx context.Context, pocketBaseURL, collectionName string) (int, error) {
+// adminAuth guards an endpoint with a static bearer token, rejecting
+// requests outright if no token is configured.
+func adminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" || c.GetHeader("Authorization") != "Bearer "+token {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/collections/%s/records?perPage=1", pocketBaseURL, collectionName), nil)
+func serveImage(c *gin.Context, router *sourceRouter, source string, trackViews bool) {
+	opts, wantsTransform, err := variantOptionsFromRequest(c)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create request: %w", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	data, contentType, id, cacheHit, upstreamLatency, err := router.fetchImage(c.Request.Context(), source, c.Query("tag"), trackViews)
 	if err != nil {
-		return 0, fmt.Errorf("request failed: %w", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Set("cache_hit", cacheHit)
+	c.Set("upstream_latency_ms", upstreamLatency.Milliseconds())
+
+	// An image without a stable identifier (e.g. a PocketBase record with an
+	// empty ID) can't be revalidated by ETag; keep serving it with the old
+	// no-store headers.
+	if id == "" {
+		metrics.ImageBytesServed.WithLabelValues(c.FullPath()).Add(float64(len(data)))
+		setNoStoreHeaders(c)
+		c.Data(http.StatusOK, contentType, data)
+		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	// Every route that reaches here (/macka, /floppapi, /img/:source,
+	// /img/random) still picks a random record per call; none of them
+	// address a record by id in the URL. So the ETag only lets a client
+	// revalidate a previously-seen pick, it must never be served with a
+	// positive max-age or a browser/CDN would pin that pick for everyone.
+	etag := variantETag(source, id, opts)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache, must-revalidate")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
 	}
 
-	var stats CollectionStats
-	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
-		return 0, fmt.Errorf("failed to decode response: %w", err)
+	if wantsTransform {
+		transformed, transformedType, err := router.variant(source, id, data, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		data, contentType = transformed, transformedType
 	}
 
-	return stats.TotalItems, nil
+	metrics.ImageBytesServed.WithLabelValues(c.FullPath()).Add(float64(len(data)))
+	c.Data(http.StatusOK, contentType, data)
 }
 
-func updateRecordViews(ctx context.Context, pocketBaseURL, collectionName, recordID string, views int) error {
-	payload := map[string]int{"views": views + 1}
-	bodyBytes, err := json.Marshal(payload)
+func serveCount(c *gin.Context, router *sourceRouter, source string) {
+	count, err := router.count(c.Request.Context(), source)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "PATCH", fmt.Sprintf("%s/api/collections/%s/records/%s", pocketBaseURL, collectionName, recordID), bytes.NewBuffer(bodyBytes))
-	if err == nil {
-		req.Header.Set("Content-Type", "application/json")
-	}
+	c.JSON(http.StatusOK, gin.H{"count": count})
+}
+
+func getRandomImage(dir string) (string, error) {
+	files, err := os.ReadDir(dir)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to read image directory: %v", err)
+	}
+
+	var imageFiles []string
+	for _, file := range files {
+		if !file.IsDir() && isImageFile(file.Name()) {
+			imageFiles = append(imageFiles, file.Name())
+		}
+	}
+
+	if len(imageFiles) == 0 {
+		return "", fmt.Errorf("no image files found in %s", dir)
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	randomIndex := rand.Intn(len(imageFiles))
+	selectedImage := imageFiles[randomIndex]
+
+	return filepath.Join(dir, selectedImage), nil
+}
+
+func countImagesInDir(dir string) (int, error) {
+	files, err := os.ReadDir(dir)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return 0, fmt.Errorf("failed to read image directory: %v", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+	count := 0
+	for _, file := range files {
+		if !file.IsDir() && isImageFile(file.Name()) {
+			count++
+		}
 	}
 
-	return nil
+	return count, nil
 }
 
 func isImageFile(filename string) bool {
@@ -284,3 +723,21 @@ func isImageFile(filename string) bool {
 		return false
 	}
 }
+
+// contentTypeForFile maps a local_dir image's extension to its Content-Type,
+// matching the set isImageFile accepts. Falls back to image/jpeg, the
+// previous hardcoded value, for anything unrecognized.
+func contentTypeForFile(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".bmp":
+		return "image/bmp"
+	case ".webp":
+		return "image/webp"
+	default:
+		return "image/jpeg"
+	}
+}